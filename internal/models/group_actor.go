@@ -0,0 +1,249 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"satellity/internal/durable"
+	"satellity/internal/session"
+	"strings"
+	"time"
+)
+
+const groupActorsDDL = `
+CREATE TABLE IF NOT EXISTS group_actors (
+	group_id      VARCHAR(36) PRIMARY KEY REFERENCES groups ON DELETE CASCADE,
+	actor_uri     VARCHAR(512) NOT NULL,
+	inbox_uri     VARCHAR(512) NOT NULL,
+	outbox_uri    VARCHAR(512) NOT NULL,
+	followers_uri VARCHAR(512) NOT NULL,
+	public_key    TEXT NOT NULL,
+	private_key   TEXT NOT NULL,
+	created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+const groupSettingsDDL = `
+CREATE TABLE IF NOT EXISTS group_settings (
+	group_id            VARCHAR(36) PRIMARY KEY REFERENCES groups ON DELETE CASCADE,
+	auto_accept_follows BOOLEAN NOT NULL DEFAULT true,
+	default_role        VARCHAR(32) NOT NULL DEFAULT 'VIEWER',
+	smtp_host           VARCHAR(256) NOT NULL DEFAULT '',
+	smtp_port           INTEGER NOT NULL DEFAULT 0,
+	smtp_username       VARCHAR(256) NOT NULL DEFAULT '',
+	smtp_password       VARCHAR(256) NOT NULL DEFAULT '',
+	smtp_from           VARCHAR(256) NOT NULL DEFAULT '',
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+// GroupActor is the ActivityPub actor document backing a Group, so remote
+// servers can follow the group and have its posts delivered to them.
+type GroupActor struct {
+	GroupID      string
+	ActorURI     string
+	InboxURI     string
+	OutboxURI    string
+	FollowersURI string
+	PublicKey    string
+	PrivateKey   string
+	CreatedAt    time.Time
+}
+
+var groupActorColumns = []string{"group_id", "actor_uri", "inbox_uri", "outbox_uri", "followers_uri", "public_key", "private_key", "created_at"}
+
+func (a *GroupActor) values() []interface{} {
+	return []interface{}{a.GroupID, a.ActorURI, a.InboxURI, a.OutboxURI, a.FollowersURI, a.PublicKey, a.PrivateKey, a.CreatedAt}
+}
+
+func groupActorFromRows(row durable.Row) (*GroupActor, error) {
+	var a GroupActor
+	err := row.Scan(&a.GroupID, &a.ActorURI, &a.InboxURI, &a.OutboxURI, &a.FollowersURI, &a.PublicKey, &a.PrivateKey, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &a, err
+}
+
+// GroupSettings holds the federation defaults for a Group, such as whether
+// incoming Follow activities are auto-accepted and which role a follower
+// is granted once accepted.
+type GroupSettings struct {
+	GroupID           string
+	AutoAcceptFollows bool
+	DefaultRole       string
+	SMTPHost          string
+	SMTPPort          int
+	SMTPUsername      string
+	SMTPPassword      string
+	SMTPFrom          string
+	CreatedAt         time.Time
+}
+
+// GroupSMTPOverride is the per-group SMTP sender configuration accepted
+// by UpdateGroupSettings; a zero value leaves the instance default in
+// place.
+type GroupSMTPOverride struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+var groupSettingsColumns = []string{"group_id", "auto_accept_follows", "default_role", "smtp_host", "smtp_port", "smtp_username", "smtp_password", "smtp_from", "created_at"}
+
+func (s *GroupSettings) values() []interface{} {
+	return []interface{}{s.GroupID, s.AutoAcceptFollows, s.DefaultRole, s.SMTPHost, s.SMTPPort, s.SMTPUsername, s.SMTPPassword, s.SMTPFrom, s.CreatedAt}
+}
+
+func groupSettingsFromRows(row durable.Row) (*GroupSettings, error) {
+	var s GroupSettings
+	err := row.Scan(&s.GroupID, &s.AutoAcceptFollows, &s.DefaultRole, &s.SMTPHost, &s.SMTPPort, &s.SMTPUsername, &s.SMTPPassword, &s.SMTPFrom, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &s, err
+}
+
+// instanceBaseURI is the public origin used to mint ActivityPub actor
+// URIs, analogous to SetNotifier for invitation delivery. Until an
+// operator configures it, group federation stays inert: actors are
+// never provisioned and findGroupActorForDelivery is a no-op.
+var instanceBaseURI string
+
+// SetInstanceBaseURI configures the public origin (e.g.
+// "https://example.com") used to provision group actors on first
+// federation use. Call once during startup, before serving requests.
+func SetInstanceBaseURI(baseURI string) {
+	instanceBaseURI = baseURI
+}
+
+// createGroupActor generates an RSA keypair and inserts the ActivityPub
+// actor document for a group that has none yet. baseURI is the public origin
+// of this instance, e.g. "https://example.com".
+func createGroupActor(ctx context.Context, tx *sql.Tx, groupID, baseURI string) (*GroupActor, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, session.ServerError(ctx, err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, session.ServerError(ctx, err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	base := strings.TrimRight(baseURI, "/") + "/groups/" + groupID
+	actor := &GroupActor{
+		GroupID:      groupID,
+		ActorURI:     base,
+		InboxURI:     base + "/inbox",
+		OutboxURI:    base + "/outbox",
+		FollowersURI: base + "/followers",
+		PublicKey:    string(publicKeyPEM),
+		PrivateKey:   string(privateKeyPEM),
+		CreatedAt:    time.Now(),
+	}
+	columns, params := durable.PrepareColumnsWithValues(groupActorColumns)
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO group_actors(%s) VALUES (%s)", columns, params), actor.values()...)
+	if err != nil {
+		return nil, err
+	}
+	return actor, nil
+}
+
+func findGroupActor(ctx context.Context, tx *sql.Tx, groupID string) (*GroupActor, error) {
+	query := fmt.Sprintf("SELECT %s FROM group_actors WHERE group_id=$1", strings.Join(groupActorColumns, ","))
+	row := tx.QueryRowContext(ctx, query, groupID)
+	return groupActorFromRows(row)
+}
+
+// ensureGroupActor resolves a group's ActivityPub actor, provisioning
+// one via createGroupActor on first use if instanceBaseURI has been
+// configured. It returns (nil, nil) when there's no actor yet and none
+// can be created, so federation features quietly no-op rather than
+// erroring until an operator sets SetInstanceBaseURI.
+func ensureGroupActor(ctx context.Context, tx *sql.Tx, groupID string) (*GroupActor, error) {
+	ga, err := findGroupActor(ctx, tx, groupID)
+	if err != nil || ga != nil {
+		return ga, err
+	}
+	if instanceBaseURI == "" {
+		return nil, nil
+	}
+	return createGroupActor(ctx, tx, groupID, instanceBaseURI)
+}
+
+// FindGroupActorDocument resolves a group's ActivityPub actor for
+// serving over GET at its own actor URI, provisioning one on first
+// request the same way findGroupActorForDelivery does for outbound
+// delivery.
+func FindGroupActorDocument(mctx *Context, groupID string) (*GroupActor, error) {
+	ctx := mctx.context
+	var actor *GroupActor
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		actor, err = ensureGroupActor(ctx, tx, groupID)
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return actor, nil
+}
+
+func findGroupSettings(ctx context.Context, tx *sql.Tx, groupID string) (*GroupSettings, error) {
+	query := fmt.Sprintf("SELECT %s FROM group_settings WHERE group_id=$1", strings.Join(groupSettingsColumns, ","))
+	row := tx.QueryRowContext(ctx, query, groupID)
+	settings, err := groupSettingsFromRows(row)
+	if err != nil || settings != nil {
+		return settings, err
+	}
+	return &GroupSettings{GroupID: groupID, AutoAcceptFollows: true, DefaultRole: ParticipantRoleVIP, CreatedAt: time.Now()}, nil
+}
+
+// UpdateGroupSettings lets the group owner configure auto-accept, the
+// default role granted to new ActivityPub followers, and an optional
+// per-group SMTP sender used instead of the instance default.
+func (group *Group) UpdateGroupSettings(mctx *Context, user *User, autoAccept bool, defaultRole string, smtp GroupSMTPOverride) (*GroupSettings, error) {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return nil, session.ForbiddenError(ctx)
+	}
+	var settings *GroupSettings
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		settings = &GroupSettings{
+			GroupID:           group.GroupID,
+			AutoAcceptFollows: autoAccept,
+			DefaultRole:       defaultRole,
+			SMTPHost:          smtp.Host,
+			SMTPPort:          smtp.Port,
+			SMTPUsername:      smtp.Username,
+			SMTPPassword:      smtp.Password,
+			SMTPFrom:          smtp.From,
+			CreatedAt:         time.Now(),
+		}
+		columns, params := durable.PrepareColumnsWithValues(groupSettingsColumns)
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO group_settings(%s) VALUES (%s)
+			ON CONFLICT (group_id) DO UPDATE SET
+				auto_accept_follows=EXCLUDED.auto_accept_follows,
+				default_role=EXCLUDED.default_role,
+				smtp_host=EXCLUDED.smtp_host,
+				smtp_port=EXCLUDED.smtp_port,
+				smtp_username=EXCLUDED.smtp_username,
+				smtp_password=EXCLUDED.smtp_password,
+				smtp_from=EXCLUDED.smtp_from
+		`, columns, params), settings.values()...)
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return settings, nil
+}
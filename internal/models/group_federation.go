@@ -0,0 +1,336 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"satellity/internal/session"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const remoteActorsDDL = `
+CREATE TABLE IF NOT EXISTS remote_actors (
+	actor_uri  VARCHAR(512) PRIMARY KEY,
+	user_id    VARCHAR(36) NOT NULL REFERENCES users ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+// Activity is the minimal subset of an ActivityStreams activity that the
+// group inbox understands: Follow/Group, Undo/Follow/Group and the Accept
+// that completes a federated invitation.
+type Activity struct {
+	ID     string      `json:"id"`
+	Type   string      `json:"type"`
+	Actor  string      `json:"actor"`
+	Object interface{} `json:"object"`
+}
+
+// ParticipantSourceFollow marks a Participant created from an accepted
+// ActivityPub Follow activity rather than a local invitation or search.
+const ParticipantSourceFollow = "follow"
+
+// HandleGroupFollow processes an inbound `Follow` activity targeting a
+// group's actor. verifiedActor is the actor URI that the caller's HTTP
+// Signature was actually verified against; it must match activity.Actor
+// or this is someone signing with their own key while claiming to be a
+// different actor, and is rejected outright. When the group is
+// configured to auto-accept followers, the remote actor is turned into
+// a local Participant with the group's configured default role and an
+// `Accept` is delivered back to the actor.
+func (group *Group) HandleGroupFollow(mctx *Context, activity *Activity, verifiedActor string) error {
+	ctx := mctx.context
+	if activity.Actor != verifiedActor {
+		return session.ForbiddenError(ctx)
+	}
+	accepted := false
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		settings, err := findGroupSettings(ctx, tx, group.GroupID)
+		if err != nil {
+			return err
+		}
+		if !settings.AutoAcceptFollows {
+			return nil
+		}
+		remoteUserID, err := findOrCreateRemoteUser(ctx, tx, activity.Actor)
+		if err != nil {
+			return err
+		}
+		group.Role = settings.DefaultRole
+		_, err = createParticipant(ctx, tx, group, remoteUserID, ParticipantSourceFollow)
+		accepted = err == nil
+		return err
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	if !accepted {
+		return nil
+	}
+	actor, err := mctx.findGroupActorForDelivery(group.GroupID)
+	if err != nil || actor == nil {
+		return err
+	}
+	accept := &Activity{
+		ID:     actor.ActorURI + "#accepts/" + activity.ID,
+		Type:   "Accept",
+		Actor:  actor.ActorURI,
+		Object: activity,
+	}
+	inboxURI, err := resolveRemoteInbox(activity.Actor)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	return deliverActivity(ctx, actor, inboxURI, accept)
+}
+
+// HandleGroupUndoFollow processes an inbound `Undo`/`Follow`/`Group`
+// activity, removing the remote actor's Participant row for the group.
+// verifiedActor must match activity.Actor, for the same reason as in
+// HandleGroupFollow: only the signer's own membership can be undone.
+func (group *Group) HandleGroupUndoFollow(mctx *Context, activity *Activity, verifiedActor string) error {
+	ctx := mctx.context
+	if activity.Actor != verifiedActor {
+		return session.ForbiddenError(ctx)
+	}
+	return mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		remoteUserID, err := findRemoteUserID(ctx, tx, activity.Actor)
+		if err != nil || remoteUserID == "" {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM participants WHERE group_id=$1 AND user_id=$2", group.GroupID, remoteUserID)
+		return err
+	})
+}
+
+func findOrCreateRemoteUser(ctx context.Context, tx *sql.Tx, actorURI string) (string, error) {
+	userID, err := findRemoteUserID(ctx, tx, actorURI)
+	if err != nil || userID != "" {
+		return userID, err
+	}
+	user, err := createUserForRemoteActor(ctx, tx, actorURI)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO remote_actors(actor_uri, user_id, created_at) VALUES ($1, $2, $3)", actorURI, user.UserID, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return user.UserID, nil
+}
+
+// createUserForRemoteActor provisions a minimal, loginless local User row
+// to represent a remote ActivityPub actor, so it can hold a Participant
+// row like any other member.
+func createUserForRemoteActor(ctx context.Context, tx *sql.Tx, actorURI string) (*User, error) {
+	user := &User{
+		UserID:    uuid.Must(uuid.NewV4()).String(),
+		Biography: actorURI,
+		CreatedAt: time.Now(),
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO users(user_id, biography, created_at) VALUES ($1, $2, $3)", user.UserID, user.Biography, user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func findRemoteUserID(ctx context.Context, tx *sql.Tx, actorURI string) (string, error) {
+	var userID string
+	err := tx.QueryRowContext(ctx, "SELECT user_id FROM remote_actors WHERE actor_uri=$1", actorURI).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userID, err
+}
+
+type deliverableActor struct {
+	ActorURI   string
+	PrivateKey string
+}
+
+// findGroupActorForDelivery resolves the group's ActivityPub actor,
+// provisioning it on first use via createGroupActor if the group
+// doesn't have one yet. This keeps actor creation from depending on a
+// hook at group-creation time, so federation works for groups created
+// before it was enabled and for newly created ones alike. It returns a
+// nil actor, nil error when instanceBaseURI hasn't been configured, in
+// which case federation features quietly no-op rather than erroring.
+func (mctx *Context) findGroupActorForDelivery(groupID string) (*deliverableActor, error) {
+	ctx := mctx.context
+	var actor *deliverableActor
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		ga, err := ensureGroupActor(ctx, tx, groupID)
+		if err != nil || ga == nil {
+			return err
+		}
+		actor = &deliverableActor{ActorURI: ga.ActorURI, PrivateKey: ga.PrivateKey}
+		return nil
+	})
+	return actor, err
+}
+
+// FindGroupForInbox loads a group by ID for the ActivityPub inbox
+// handler, mirroring the lookup used by invite-link redemption.
+func FindGroupForInbox(mctx *Context, groupID string) (*Group, error) {
+	ctx := mctx.context
+	var group *Group
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		group, err = findGroup(ctx, tx, groupID)
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return group, nil
+}
+
+// remoteActorDocument is the subset of an ActivityPub actor document
+// needed to verify inbound HTTP Signatures and to deliver outbound
+// activities to the right endpoint.
+type remoteActorDocument struct {
+	Inbox     string `json:"inbox"`
+	PublicKey struct {
+		ID           string `json:"id"`
+		PublicKeyPem string `json:"publicKeyPem"`
+	} `json:"publicKey"`
+}
+
+// fetchRemoteActorDocument fetches and decodes the ActivityPub actor
+// document at actorURI.
+func fetchRemoteActorDocument(actorURI string) (*remoteActorDocument, error) {
+	req, err := http.NewRequest(http.MethodGet, actorURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/activity+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetching actor %s failed with status %d", actorURI, resp.StatusCode)
+	}
+	var doc remoteActorDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// resolveRemoteInbox fetches the actor document at actorURI and
+// returns its inbox URL, so outbound deliveries land on the endpoint
+// the actor actually reads rather than on its identifying actor URI.
+func resolveRemoteInbox(actorURI string) (string, error) {
+	doc, err := fetchRemoteActorDocument(actorURI)
+	if err != nil {
+		return "", err
+	}
+	if doc.Inbox == "" {
+		return "", fmt.Errorf("actor %s has no inbox", actorURI)
+	}
+	return doc.Inbox, nil
+}
+
+// FetchRemoteActorKey resolves the PEM encoded public key for an
+// ActivityPub `keyId` (an actor URI, optionally with a "#main-key"
+// fragment) by fetching the actor document over HTTP. It matches
+// middleware.KeyFetcher's signature so it can be passed directly to
+// middleware.HTTPSignature.
+func FetchRemoteActorKey(header http.Header, keyID string) (string, error) {
+	actorURI := strings.SplitN(keyID, "#", 2)[0]
+	doc, err := fetchRemoteActorDocument(actorURI)
+	if err != nil {
+		return "", err
+	}
+	if doc.PublicKey.PublicKeyPem == "" {
+		return "", fmt.Errorf("actor %s has no publicKeyPem", actorURI)
+	}
+	return doc.PublicKey.PublicKeyPem, nil
+}
+
+// deliverActivity POSTs a signed activity to a remote inbox, using the
+// group actor's private key to produce an HTTP Signature over the
+// request, per the pattern used elsewhere for signed delivery.
+func deliverActivity(ctx context.Context, actor *deliverableActor, inboxURI string, activity *Activity) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inboxURI, bytes.NewReader(body))
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	req.Header.Set("Content-Type", "application/activity+json")
+	if err := signRequest(req, body, actor.ActorURI+"#main-key", actor.PrivateKey); err != nil {
+		return session.ServerError(ctx, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return session.ServerError(ctx, fmt.Errorf("federated delivery to %s failed with status %d", inboxURI, resp.StatusCode))
+	}
+	return nil
+}
+
+// signRequest produces a draft-cavage HTTP Signature over the request's
+// (request-target), host and digest headers, keyed by a PEM encoded RSA
+// private key.
+func signRequest(req *http.Request, body []byte, keyID, privateKeyPEM string) error {
+	digest := sha256.Sum256(body)
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]))
+	req.Header.Set("Host", req.URL.Host)
+
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return fmt.Errorf("invalid private key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	signedHeaders := []string{"(request-target)", "host", "digest"}
+	signingString := buildSigningString(req, signedHeaders)
+	hashed := sha256.Sum256([]byte(signingString))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(signedHeaders, " "), base64.StdEncoding.EncodeToString(signature),
+	))
+	return nil
+}
+
+func buildSigningString(req *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		if h == "(request-target)" {
+			lines[i] = fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.RequestURI())
+			continue
+		}
+		lines[i] = fmt.Sprintf("%s: %s", h, req.Header.Get(h))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/rand"
 	"database/sql"
-	"encoding/binary"
 	"fmt"
 	"satellity/internal/durable"
 	"satellity/internal/session"
@@ -19,8 +18,12 @@ CREATE TABLE IF NOT EXISTS group_invitations (
 	invitation_id          VARCHAR(36) PRIMARY KEY,
 	group_id               VARCHAR(36) NOT NULL REFERENCES groups ON DELETE CASCADE,
 	email                  VARCHAR(512) NOT NULL,
+	actor_uri              VARCHAR(512) NOT NULL DEFAULT '',
 	code                   VARCHAR(128) NOT NULL,
 	sent_at                TIMESTAMP WITH TIME ZONE,
+	sent_error             VARCHAR(1024) NOT NULL DEFAULT '',
+	send_attempts          INTEGER NOT NULL DEFAULT 0,
+	last_attempt_at        TIMESTAMP WITH TIME ZONE,
 	created_at             TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
@@ -31,68 +34,240 @@ const (
 	MaxGroupInvitations = 7
 )
 
-// GroupInvitation is a way to invate user to group for free
+// GroupInvitation is a way to invate user to group for free. Email is set
+// for local invitations; ActorURI is set instead when the invitation
+// targets a remote ActivityPub actor.
 type GroupInvitation struct {
-	InvitationID string
-	GroupID      string
-	Email        string
-	Code         string
-	SentAt       time.Time
-	CreatedAt    time.Time
+	InvitationID  string
+	GroupID       string
+	Email         string
+	ActorURI      string
+	Code          string
+	SentAt        time.Time
+	SentError     string
+	SendAttempts  int64
+	LastAttemptAt time.Time
+	CreatedAt     time.Time
 }
 
-var groupInvitationColumns = []string{"invitation_id", "group_id", "email", "code", "sent_at", "created_at"}
+var groupInvitationColumns = []string{"invitation_id", "group_id", "email", "actor_uri", "code", "sent_at", "sent_error", "send_attempts", "last_attempt_at", "created_at"}
 
 func (i *GroupInvitation) values() []interface{} {
-	return []interface{}{i.InvitationID, i.GroupID, i.Email, i.Code, i.SentAt, i.CreatedAt}
+	var sentAt interface{}
+	if !i.SentAt.IsZero() {
+		sentAt = i.SentAt
+	}
+	return []interface{}{i.InvitationID, i.GroupID, i.Email, i.ActorURI, i.Code, sentAt, i.SentError, i.SendAttempts, i.LastAttemptAt, i.CreatedAt}
 }
 
 func groupInvitationFromRows(row durable.Row) (*GroupInvitation, error) {
 	var i GroupInvitation
-	err := row.Scan(&i.InvitationID, &i.GroupID, &i.Email, &i.Code, &i.SentAt, &i.CreatedAt)
+	var sentAt, lastAttempt sql.NullTime
+	err := row.Scan(&i.InvitationID, &i.GroupID, &i.Email, &i.ActorURI, &i.Code, &sentAt, &i.SentError, &i.SendAttempts, &lastAttempt, &i.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	i.SentAt = sentAt.Time
+	i.LastAttemptAt = lastAttempt.Time
 	return &i, err
 }
 
 // CreateGroupInvitation create a group invitation by email
 func (user *User) CreateGroupInvitation(mctx *Context, groupID, email string) (*GroupInvitation, error) {
+	return user.createGroupInvitation(mctx, groupID, email, "")
+}
+
+// CreateGroupActorInvitation invites a remote ActivityPub actor into the
+// group instead of a local email address. The invitation is delivered as
+// a signed activity to the actor's inbox rather than by the notifier.
+func (user *User) CreateGroupActorInvitation(mctx *Context, groupID, actorURI string) (*GroupInvitation, error) {
+	return user.createGroupInvitation(mctx, groupID, "", actorURI)
+}
+
+// insertInvitationRow enforces the per-group cap and issuance rate limits
+// and inserts a single invitation row. It must run inside the caller's
+// transaction, since both the single-email and bulk paths share it.
+func insertInvitationRow(ctx context.Context, tx *sql.Tx, group *Group, user *User, email, actorURI string) (*GroupInvitation, error) {
+	row := tx.QueryRowContext(ctx, "SELECT count(*) FROM group_invitations WHERE group_id=$1", group.GroupID)
+	var count int64
+	if err := row.Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= MaxGroupInvitations {
+		return nil, session.TooManyGroupInvitationsError(ctx)
+	}
+
+	if err := checkAndRecordRateLimit(ctx, tx, "issue:user:"+user.UserID+":group:"+group.GroupID, IssuanceRateLimit, IssuanceRateWindow); err != nil {
+		return nil, err
+	}
+	if email != "" {
+		if err := checkAndRecordRateLimit(ctx, tx, "issue:email:"+email+":group:"+group.GroupID, IssuanceRateLimit, IssuanceRateWindow); err != nil {
+			return nil, err
+		}
+	}
+
+	invitation := &GroupInvitation{
+		InvitationID: uuid.Must(uuid.NewV4()).String(),
+		GroupID:      group.GroupID,
+		Email:        email,
+		ActorURI:     actorURI,
+		CreatedAt:    time.Now(),
+	}
+	var err error
+	invitation.Code, err = generateVerificationCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	columns, params := durable.PrepareColumnsWithValues(groupInvitationColumns)
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO group_invitations(%s) VALUES (%s)", columns, params), invitation.values()...)
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (user *User) createGroupInvitation(mctx *Context, groupID, email, actorURI string) (*GroupInvitation, error) {
 	ctx := mctx.context
 
 	var invitation *GroupInvitation
+	var groupName string
 	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
-		row := tx.QueryRowContext(ctx, "SELECT count(*) FROM group_invitations WHERE group_id=$1", groupID)
-		var count int64
-		err := row.Scan(&count)
+		group, err := findGroup(ctx, tx, groupID)
 		if err != nil {
 			return err
+		} else if group == nil {
+			return nil
+		} else if user.UserID != group.UserID {
+			return session.ForbiddenError(ctx)
+		}
+		groupName = group.Name
+
+		invitation, err = insertInvitationRow(ctx, tx, group, user, email, actorURI)
+		return err
+	})
+	if err != nil {
+		if _, ok := err.(session.Error); ok {
+			return nil, err
 		}
-		if count > 7 {
-			return session.TooManyGroupInvitationsError(ctx)
+		return nil, session.TransactionError(ctx, err)
+	}
+	if invitation != nil && invitation.ActorURI != "" {
+		actor, err := mctx.findGroupActorForDelivery(groupID)
+		if err != nil {
+			return nil, err
 		}
+		if actor != nil {
+			invite := &Activity{
+				ID:     actor.ActorURI + "#invites/" + invitation.InvitationID,
+				Type:   "Invite",
+				Actor:  actor.ActorURI,
+				Object: invitation.Code,
+			}
+			inboxURI, err := resolveRemoteInbox(invitation.ActorURI)
+			if err != nil {
+				return nil, session.ServerError(ctx, err)
+			}
+			if err := deliverActivity(ctx, actor, inboxURI, invite); err != nil {
+				return nil, err
+			}
+		}
+	} else if invitation != nil {
+		// Delivery failures are recorded on the invitation row rather than
+		// returned here: RunInvitationDeliveryWorker retries them, so a
+		// transient SMTP/webhook failure doesn't drop the invite.
+		deliverInvitation(ctx, mctx.database, invitation, groupName)
+	}
+	return invitation, nil
+}
+
+// BulkInvitationResult is the per-row outcome of CreateGroupInvitationsBulk.
+type BulkInvitationResult struct {
+	Email      string
+	Invitation *GroupInvitation
+	Error      string
+}
+
+// planBulkInvitations decides, ahead of any DB work, which requested
+// emails are even worth attempting: an email repeated later in the same
+// request is rejected outright, rather than being charged against the
+// issuance rate limit a second time, and emails beyond
+// MaxGroupInvitations (counting existingCount plus everything accepted
+// so far in this batch) are rejected for being over the cap. It has no
+// DB access, so it can't see invitations that already exist for the
+// group in prior requests — CreateGroupInvitationsBulk still checks
+// that separately for each accepted email.
+func planBulkInvitations(emails []string, existingCount int64) (accepted []string, rejected []BulkInvitationResult) {
+	seen := make(map[string]bool, len(emails))
+	count := existingCount
+	for _, raw := range emails {
+		email := strings.TrimSpace(raw)
+		if seen[email] {
+			rejected = append(rejected, BulkInvitationResult{Email: email, Error: "duplicate in request"})
+			continue
+		}
+		seen[email] = true
+		if count >= MaxGroupInvitations {
+			rejected = append(rejected, BulkInvitationResult{Email: email, Error: "too many invitations"})
+			continue
+		}
+		count++
+		accepted = append(accepted, email)
+	}
+	return accepted, rejected
+}
+
+// CreateGroupInvitationsBulk issues invitations for a list of emails in a
+// single transaction, deduping against invitations that already exist
+// for the group and reporting a per-row success or error rather than
+// failing the whole batch on the first problem.
+func (user *User) CreateGroupInvitationsBulk(mctx *Context, groupID string, emails []string) ([]BulkInvitationResult, error) {
+	ctx := mctx.context
+
+	var results []BulkInvitationResult
+	var groupName string
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
 		group, err := findGroup(ctx, tx, groupID)
 		if err != nil {
 			return err
 		} else if group == nil {
-			return nil
+			return session.NotFoundError(ctx)
 		} else if user.UserID != group.UserID {
 			return session.ForbiddenError(ctx)
 		}
+		groupName = group.Name
 
-		invitation = &GroupInvitation{
-			InvitationID: uuid.Must(uuid.NewV4()).String(),
-			GroupID:      group.GroupID,
-			Email:        email,
-			CreatedAt:    time.Now(),
-		}
-		invitation.Code, err = generateVerificationCode(ctx)
-		if err != nil {
+		var existingCount int64
+		if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM group_invitations WHERE group_id=$1", groupID).Scan(&existingCount); err != nil {
 			return err
 		}
-		columns, params := durable.PrepareColumnsWithValues(groupInvitationColumns)
-		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO group_invitations(%s) VALUES (%s)", columns, params), invitation.values()...)
-		return err
+		accepted, rejected := planBulkInvitations(emails, existingCount)
+		results = append(results, rejected...)
+
+		for _, email := range accepted {
+			result := BulkInvitationResult{Email: email}
+
+			existing, err := findGroupInvitationByGroupIDAndEmail(ctx, tx, groupID, email)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				result.Error = "already invited"
+				results = append(results, result)
+				continue
+			}
+
+			invitation, err := insertInvitationRow(ctx, tx, group, user, email, "")
+			if sessionErr, ok := err.(session.Error); ok {
+				result.Error = sessionErr.Error()
+				results = append(results, result)
+				continue
+			} else if err != nil {
+				return err
+			}
+			result.Invitation = invitation
+			results = append(results, result)
+		}
+		return nil
 	})
 	if err != nil {
 		if _, ok := err.(session.Error); ok {
@@ -100,13 +275,21 @@ func (user *User) CreateGroupInvitation(mctx *Context, groupID, email string) (*
 		}
 		return nil, session.TransactionError(ctx, err)
 	}
-	return invitation, nil
+	for _, result := range results {
+		if result.Invitation != nil {
+			deliverInvitation(ctx, mctx.database, result.Invitation, groupName)
+		}
+	}
+	return results, nil
 }
 
-// JoinGroupByInvitation join the group by invitation code
-func (user *User) JoinGroupByInvitation(mctx *Context, groupID, code string) (*Group, error) {
+// JoinGroupByInvitation join the group by invitation code. ip is the
+// requester's remote address, used to throttle and eventually invalidate
+// an invitation that is being brute-forced.
+func (user *User) JoinGroupByInvitation(mctx *Context, groupID, code, ip string) (*Group, error) {
 	ctx := mctx.context
 	var group *Group
+	var codeErr error
 	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
 		var err error
 		group, err = findGroup(ctx, tx, groupID)
@@ -118,7 +301,20 @@ func (user *User) JoinGroupByInvitation(mctx *Context, groupID, code string) (*G
 			return err
 		}
 		if invitation.Code != strings.TrimSpace(code) {
-			return session.InvalidGroupInvitationCodeError(ctx)
+			// The failure (and a lockout's delete) is committed before the
+			// code error is returned, so failed attempts accumulate.
+			failures, ferr := recordInvitationFailure(ctx, tx, invitation.InvitationID, ip)
+			if ferr != nil {
+				return ferr
+			}
+			codeErr = session.InvalidGroupInvitationCodeError(ctx)
+			if invitationLockedOut(failures) {
+				if _, err := tx.ExecContext(ctx, "DELETE FROM group_invitations WHERE invitation_id=$1", invitation.InvitationID); err != nil {
+					return err
+				}
+				codeErr = session.InvitationLockedError(ctx)
+			}
+			return nil
 		}
 		owner, err := findUserByID(ctx, tx, group.UserID)
 		if err != nil {
@@ -137,7 +333,11 @@ func (user *User) JoinGroupByInvitation(mctx *Context, groupID, code string) (*G
 			return err
 		}
 
-		group.Role = ParticipantRoleVIP
+		settings, err := findGroupSettings(ctx, tx, group.GroupID)
+		if err != nil {
+			return err
+		}
+		group.Role = settings.DefaultRole
 		_, err = createParticipant(ctx, tx, group, user.UserID, ParticipantSourceInvitation)
 		if err != nil {
 			return err
@@ -151,6 +351,9 @@ func (user *User) JoinGroupByInvitation(mctx *Context, groupID, code string) (*G
 		}
 		return nil, session.TransactionError(ctx, err)
 	}
+	if codeErr != nil {
+		return nil, codeErr
+	}
 	return group, nil
 }
 
@@ -160,15 +363,100 @@ func findGroupInvitationByGroupIDAndEmail(ctx context.Context, tx *sql.Tx, group
 	return groupInvitationFromRows(row)
 }
 
+func findGroupInvitationByGroupIDAndActorURI(ctx context.Context, tx *sql.Tx, groupID, actorURI string) (*GroupInvitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM group_invitations WHERE group_id=$1 AND actor_uri=$2 LIMIT 1", strings.Join(groupInvitationColumns, ","))
+	row := tx.QueryRowContext(ctx, query, groupID, actorURI)
+	return groupInvitationFromRows(row)
+}
+
+// JoinGroupByFederatedInvitation completes a remote actor invitation once
+// the actor has signed and delivered an `Accept` for our `Invite`. The
+// signature itself is verified by the HTTPSignature middleware before
+// this is called; here we check that the Accept comes from actorURI and
+// references the invitation code we sent.
+func JoinGroupByFederatedInvitation(mctx *Context, groupID, actorURI string, accept *Activity) (*Group, error) {
+	ctx := mctx.context
+	if accept.Actor != actorURI {
+		return nil, session.ForbiddenError(ctx)
+	}
+	var group *Group
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		group, err = findGroup(ctx, tx, groupID)
+		if err != nil || group == nil {
+			return err
+		}
+		invitation, err := findGroupInvitationByGroupIDAndActorURI(ctx, tx, group.GroupID, actorURI)
+		if err != nil || invitation == nil {
+			return err
+		}
+		code, _ := accept.Object.(string)
+		if invitation.Code != strings.TrimSpace(code) {
+			return session.InvalidGroupInvitationCodeError(ctx)
+		}
+		owner, err := findUserByID(ctx, tx, group.UserID)
+		if err != nil {
+			return err
+		}
+		group.User = owner
+
+		remoteUserID, err := findOrCreateRemoteUser(ctx, tx, actorURI)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		err = tx.QueryRowContext(ctx, "SELECT count(*) FROM participants WHERE group_id=$1", groupID).Scan(&count)
+		if err != nil {
+			return err
+		}
+		group.UsersCount = count + 1
+		_, err = tx.ExecContext(ctx, "UPDATE groups SET users_count=$1 WHERE group_id=$2", group.UsersCount, group.GroupID)
+		if err != nil {
+			return err
+		}
+
+		settings, err := findGroupSettings(ctx, tx, group.GroupID)
+		if err != nil {
+			return err
+		}
+		group.Role = settings.DefaultRole
+		_, err = createParticipant(ctx, tx, group, remoteUserID, ParticipantSourceInvitation)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM group_invitations WHERE invitation_id=$1", invitation.InvitationID)
+		return err
+	})
+	if err != nil {
+		if _, ok := err.(session.Error); ok {
+			return nil, err
+		}
+		return nil, session.TransactionError(ctx, err)
+	}
+	return group, nil
+}
+
+// verificationCodeLength is the number of alphanumeric characters in a
+// generated invitation code. 4 digits offers only ~13 bits of entropy,
+// which is cheap to brute force even with the attempt lockout above.
+const verificationCodeLength = 8
+
+const verificationCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
 func generateVerificationCode(ctx context.Context) (string, error) {
-	var b [8]byte
-	_, err := rand.Read(b[:])
+	return generateVerificationCodeOfLength(ctx, verificationCodeLength)
+}
+
+func generateVerificationCodeOfLength(ctx context.Context, length int) (string, error) {
+	b := make([]byte, length)
+	_, err := rand.Read(b)
 	if err != nil {
 		return "", session.ServerError(ctx, err)
 	}
-	c := binary.LittleEndian.Uint64(b[:]) % 10000
-	if c < 1000 {
-		c = 1000 + c
+	code := make([]byte, length)
+	for i, v := range b {
+		code[i] = verificationCodeAlphabet[int(v)%len(verificationCodeAlphabet)]
 	}
-	return fmt.Sprint(c), nil
+	return string(code), nil
 }
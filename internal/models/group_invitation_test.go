@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlanBulkInvitationsDedupesWithinRequest(t *testing.T) {
+	accepted, rejected := planBulkInvitations([]string{"a@x.com", " a@x.com ", "b@x.com"}, 0)
+
+	wantAccepted := []string{"a@x.com", "b@x.com"}
+	if len(accepted) != len(wantAccepted) {
+		t.Fatalf("accepted = %v, want %v", accepted, wantAccepted)
+	}
+	for i, email := range wantAccepted {
+		if accepted[i] != email {
+			t.Errorf("accepted[%d] = %q, want %q", i, accepted[i], email)
+		}
+	}
+
+	if len(rejected) != 1 || rejected[0].Email != "a@x.com" || rejected[0].Error != "duplicate in request" {
+		t.Errorf("rejected = %+v, want one duplicate rejection for a@x.com", rejected)
+	}
+}
+
+func TestPlanBulkInvitationsEnforcesCap(t *testing.T) {
+	var emails []string
+	for i := 0; i < MaxGroupInvitations+2; i++ {
+		emails = append(emails, fmt.Sprintf("user%d@x.com", i))
+	}
+
+	accepted, rejected := planBulkInvitations(emails, 0)
+	if len(accepted) != MaxGroupInvitations {
+		t.Errorf("len(accepted) = %d, want %d", len(accepted), MaxGroupInvitations)
+	}
+	if len(rejected) != 2 {
+		t.Fatalf("len(rejected) = %d, want 2", len(rejected))
+	}
+	for _, r := range rejected {
+		if r.Error != "too many invitations" {
+			t.Errorf("rejected[%s].Error = %q, want %q", r.Email, r.Error, "too many invitations")
+		}
+	}
+}
+
+func TestPlanBulkInvitationsRespectsExistingCount(t *testing.T) {
+	accepted, rejected := planBulkInvitations([]string{"a@x.com", "b@x.com"}, MaxGroupInvitations-1)
+
+	if len(accepted) != 1 || accepted[0] != "a@x.com" {
+		t.Errorf("accepted = %v, want [a@x.com]", accepted)
+	}
+	if len(rejected) != 1 || rejected[0].Email != "b@x.com" || rejected[0].Error != "too many invitations" {
+		t.Errorf("rejected = %+v, want one cap rejection for b@x.com", rejected)
+	}
+}
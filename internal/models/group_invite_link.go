@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"satellity/internal/durable"
+	"satellity/internal/session"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const groupInviteLinksDDL = `
+CREATE TABLE IF NOT EXISTS group_invite_links (
+	link_id    VARCHAR(36) PRIMARY KEY,
+	group_id   VARCHAR(36) NOT NULL REFERENCES groups ON DELETE CASCADE,
+	code       VARCHAR(128) NOT NULL UNIQUE,
+	max_uses   INTEGER NOT NULL,
+	uses       INTEGER NOT NULL DEFAULT 0,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	revoked_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+// MaxGroupInviteLinks bounds how many live (non-revoked, unexpired) invite links a
+// group may have outstanding at once. Unlike MaxGroupInvitations, this
+// cap is independent of per-email invitations.
+const MaxGroupInviteLinks = 20
+
+// GroupInviteLink is a reusable, shareable join code for a group, good
+// for MaxUses redemptions until ExpiresAt, independent of any single
+// invitee's email.
+type GroupInviteLink struct {
+	LinkID    string
+	GroupID   string
+	Code      string
+	MaxUses   int64
+	Uses      int64
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	CreatedAt time.Time
+}
+
+var groupInviteLinkColumns = []string{"link_id", "group_id", "code", "max_uses", "uses", "expires_at", "revoked_at", "created_at"}
+
+func (l *GroupInviteLink) values() []interface{} {
+	return []interface{}{l.LinkID, l.GroupID, l.Code, l.MaxUses, l.Uses, l.ExpiresAt, l.RevokedAt, l.CreatedAt}
+}
+
+func groupInviteLinkFromRows(row durable.Row) (*GroupInviteLink, error) {
+	var l GroupInviteLink
+	err := row.Scan(&l.LinkID, &l.GroupID, &l.Code, &l.MaxUses, &l.Uses, &l.ExpiresAt, &l.RevokedAt, &l.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &l, err
+}
+
+// CreateGroupInviteLink mints a new shareable invite code for the group,
+// good for maxUses redemptions until expiresAt. Only the group's owner
+// may mint one.
+func (group *Group) CreateGroupInviteLink(mctx *Context, user *User, maxUses int64, expiresAt time.Time) (*GroupInviteLink, error) {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return nil, session.ForbiddenError(ctx)
+	}
+	var link *GroupInviteLink
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var count int64
+		err := tx.QueryRowContext(ctx, "SELECT count(*) FROM group_invite_links WHERE group_id=$1 AND revoked_at IS NULL AND expires_at > $2", group.GroupID, time.Now()).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count >= MaxGroupInviteLinks {
+			return session.TooManyGroupInviteLinksError(ctx)
+		}
+
+		code, err := generateVerificationCodeOfLength(ctx, verificationCodeLength)
+		if err != nil {
+			return err
+		}
+		link = &GroupInviteLink{
+			LinkID:    uuid.Must(uuid.NewV4()).String(),
+			GroupID:   group.GroupID,
+			Code:      code,
+			MaxUses:   maxUses,
+			ExpiresAt: expiresAt,
+			CreatedAt: time.Now(),
+		}
+		columns, params := durable.PrepareColumnsWithValues(groupInviteLinkColumns)
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO group_invite_links(%s) VALUES (%s)", columns, params), link.values()...)
+		return err
+	})
+	if err != nil {
+		if _, ok := err.(session.Error); ok {
+			return nil, err
+		}
+		return nil, session.TransactionError(ctx, err)
+	}
+	return link, nil
+}
+
+// RevokeGroupInviteLink is the admin revocation endpoint: it immediately
+// stops a link from being redeemable, without touching uses already
+// granted through it. Only the group's owner may revoke one.
+func (group *Group) RevokeGroupInviteLink(mctx *Context, user *User, linkID string) error {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return session.ForbiddenError(ctx)
+	}
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "UPDATE group_invite_links SET revoked_at=$1 WHERE link_id=$2 AND group_id=$3 AND revoked_at IS NULL", time.Now(), linkID, group.GroupID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return session.NotFoundError(ctx)
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(session.Error); ok {
+			return err
+		}
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func findGroupInviteLinkByCode(ctx context.Context, tx *sql.Tx, code string) (*GroupInviteLink, error) {
+	query := fmt.Sprintf("SELECT %s FROM group_invite_links WHERE code=$1", strings.Join(groupInviteLinkColumns, ","))
+	row := tx.QueryRowContext(ctx, query, code)
+	return groupInviteLinkFromRows(row)
+}
+
+// JoinGroupByInviteLink redeems a shareable invite link: it's valid for
+// any authenticated user, not just one invited by email, subject to the
+// link's own max-uses and expiry.
+func (user *User) JoinGroupByInviteLink(mctx *Context, code string) (*Group, error) {
+	ctx := mctx.context
+	var group *Group
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		link, err := findGroupInviteLinkByCode(ctx, tx, strings.TrimSpace(code))
+		if err != nil {
+			return err
+		} else if link == nil {
+			return session.InvalidGroupInvitationCodeError(ctx)
+		}
+		if link.RevokedAt.Valid || time.Now().After(link.ExpiresAt) || link.Uses >= link.MaxUses {
+			return session.InvalidGroupInvitationCodeError(ctx)
+		}
+
+		group, err = findGroup(ctx, tx, link.GroupID)
+		if err != nil || group == nil {
+			return err
+		}
+		owner, err := findUserByID(ctx, tx, group.UserID)
+		if err != nil {
+			return err
+		}
+		group.User = owner
+
+		result, err := tx.ExecContext(ctx, "UPDATE group_invite_links SET uses=uses+1 WHERE link_id=$1 AND uses < max_uses", link.LinkID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return session.InvalidGroupInvitationCodeError(ctx)
+		}
+
+		var count int64
+		err = tx.QueryRowContext(ctx, "SELECT count(*) FROM participants WHERE group_id=$1", group.GroupID).Scan(&count)
+		if err != nil {
+			return err
+		}
+		group.UsersCount = count + 1
+		_, err = tx.ExecContext(ctx, "UPDATE groups SET users_count=$1 WHERE group_id=$2", group.UsersCount, group.GroupID)
+		if err != nil {
+			return err
+		}
+
+		settings, err := findGroupSettings(ctx, tx, group.GroupID)
+		if err != nil {
+			return err
+		}
+		group.Role = settings.DefaultRole
+		_, err = createParticipant(ctx, tx, group, user.UserID, ParticipantSourceInvitation)
+		return err
+	})
+	if err != nil {
+		if _, ok := err.(session.Error); ok {
+			return nil, err
+		}
+		return nil, session.TransactionError(ctx, err)
+	}
+	return group, nil
+}
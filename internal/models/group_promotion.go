@@ -0,0 +1,218 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"satellity/internal/durable"
+	"satellity/internal/session"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const groupPromotionsDDL = `
+CREATE TABLE IF NOT EXISTS group_promotions (
+	promotion_id    VARCHAR(36) PRIMARY KEY,
+	group_id        VARCHAR(36) NOT NULL REFERENCES groups ON DELETE CASCADE,
+	from_role_id    VARCHAR(36) NOT NULL REFERENCES group_roles ON DELETE CASCADE,
+	to_role_id      VARCHAR(36) NOT NULL REFERENCES group_roles ON DELETE CASCADE,
+	min_days_member INTEGER NOT NULL DEFAULT 0,
+	min_posts       INTEGER NOT NULL DEFAULT 0,
+	created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+// GroupPromotion is an owner-defined rule auto-graduating participants
+// from one role to another once they meet tenure and activity
+// thresholds, so communities don't need a human to promote every
+// viewer who sticks around.
+type GroupPromotion struct {
+	PromotionID   string
+	GroupID       string
+	FromRoleID    string
+	ToRoleID      string
+	MinDaysMember int64
+	MinPosts      int64
+	CreatedAt     time.Time
+}
+
+var groupPromotionColumns = []string{"promotion_id", "group_id", "from_role_id", "to_role_id", "min_days_member", "min_posts", "created_at"}
+
+func (p *GroupPromotion) values() []interface{} {
+	return []interface{}{p.PromotionID, p.GroupID, p.FromRoleID, p.ToRoleID, p.MinDaysMember, p.MinPosts, p.CreatedAt}
+}
+
+func groupPromotionFromRows(row durable.Row) (*GroupPromotion, error) {
+	var p GroupPromotion
+	err := row.Scan(&p.PromotionID, &p.GroupID, &p.FromRoleID, &p.ToRoleID, &p.MinDaysMember, &p.MinPosts, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &p, err
+}
+
+// CreateGroupPromotion defines a new auto-promotion rule for the group:
+// after minDaysMember days of membership and minPosts posts, a
+// participant holding fromRoleID is promoted to toRoleID. Only the
+// group's owner may define promotion rules.
+func (group *Group) CreateGroupPromotion(mctx *Context, user *User, fromRoleID, toRoleID string, minDaysMember, minPosts int64) (*GroupPromotion, error) {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return nil, session.ForbiddenError(ctx)
+	}
+	promotion := &GroupPromotion{
+		PromotionID:   uuid.Must(uuid.NewV4()).String(),
+		GroupID:       group.GroupID,
+		FromRoleID:    fromRoleID,
+		ToRoleID:      toRoleID,
+		MinDaysMember: minDaysMember,
+		MinPosts:      minPosts,
+		CreatedAt:     time.Now(),
+	}
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		columns, params := durable.PrepareColumnsWithValues(groupPromotionColumns)
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO group_promotions(%s) VALUES (%s)", columns, params), promotion.values()...)
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return promotion, nil
+}
+
+// DeleteGroupPromotion removes an auto-promotion rule. Only the
+// group's owner may delete one.
+func (group *Group) DeleteGroupPromotion(mctx *Context, user *User, promotionID string) error {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return session.ForbiddenError(ctx)
+	}
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM group_promotions WHERE promotion_id=$1 AND group_id=$2", promotionID, group.GroupID)
+		return err
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func findGroupPromotions(ctx context.Context, tx *sql.Tx, groupID string) ([]*GroupPromotion, error) {
+	query := fmt.Sprintf("SELECT %s FROM group_promotions WHERE group_id=$1", strings.Join(groupPromotionColumns, ","))
+	rows, err := tx.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []*GroupPromotion
+	for rows.Next() {
+		promotion, err := groupPromotionFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+func findAllGroupPromotions(ctx context.Context, tx *sql.Tx) ([]*GroupPromotion, error) {
+	query := fmt.Sprintf("SELECT %s FROM group_promotions", strings.Join(groupPromotionColumns, ","))
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []*GroupPromotion
+	for rows.Next() {
+		promotion, err := groupPromotionFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+// applyGroupPromotion promotes every participant matching a single rule
+// in one transaction: holding FromRoleID, joined at least MinDaysMember
+// days ago, with at least MinPosts posts in the group.
+func applyGroupPromotion(ctx context.Context, db *durable.Database, promotion *GroupPromotion) error {
+	return db.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		fromRole, err := findGroupRole(ctx, tx, promotion.FromRoleID)
+		if err != nil || fromRole == nil {
+			return err
+		}
+		toRole, err := findGroupRole(ctx, tx, promotion.ToRoleID)
+		if err != nil || toRole == nil {
+			return err
+		}
+		cutoff := time.Now().AddDate(0, 0, -int(promotion.MinDaysMember))
+		rows, err := tx.QueryContext(ctx, `
+			SELECT user_id FROM participants
+			WHERE group_id=$1 AND role=$2 AND created_at <= $3
+			AND (SELECT count(*) FROM posts WHERE posts.group_id=participants.group_id AND posts.user_id=participants.user_id) >= $4
+		`, promotion.GroupID, fromRole.Name, cutoff, promotion.MinPosts)
+		if err != nil {
+			return err
+		}
+		var userIDs []string
+		for rows.Next() {
+			var userID string
+			if err := rows.Scan(&userID); err != nil {
+				rows.Close()
+				return err
+			}
+			userIDs = append(userIDs, userID)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return err
+		}
+		rows.Close()
+
+		for _, userID := range userIDs {
+			if _, err := tx.ExecContext(ctx, "UPDATE participants SET role=$1 WHERE group_id=$2 AND user_id=$3", toRole.Name, promotion.GroupID, userID); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO group_role_assignments(assignment_id, group_id, user_id, role_id, created_at)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (group_id, user_id) DO UPDATE SET role_id=EXCLUDED.role_id, created_at=EXCLUDED.created_at
+			`, uuid.Must(uuid.NewV4()).String(), promotion.GroupID, userID, toRole.RoleID, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunScheduledPromotions scans every group's promotion rules and applies
+// them, so owners don't have to manually promote members who've met the
+// tenure/activity thresholds. Intended to be called periodically from a
+// background job alongside RunInvitationDeliveryWorker.
+//
+// A single rule failing (e.g. a dangling role reference) doesn't abort
+// the scan: like retryUnsentInvitations, we continue past it so every
+// other group's promotions still run this cycle.
+func RunScheduledPromotions(ctx context.Context, db *durable.Database) error {
+	var promotions []*GroupPromotion
+	err := db.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		promotions, err = findAllGroupPromotions(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, promotion := range promotions {
+		if err := applyGroupPromotion(ctx, db, promotion); err != nil {
+			continue
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"satellity/internal/durable"
+	"satellity/internal/session"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const groupRolesDDL = `
+CREATE TABLE IF NOT EXISTS group_roles (
+	role_id    VARCHAR(36) PRIMARY KEY,
+	group_id   VARCHAR(36) NOT NULL REFERENCES groups ON DELETE CASCADE,
+	name       VARCHAR(64) NOT NULL,
+	is_admin   BOOLEAN NOT NULL DEFAULT false,
+	is_mod     BOOLEAN NOT NULL DEFAULT false,
+	can_post   BOOLEAN NOT NULL DEFAULT true,
+	can_invite BOOLEAN NOT NULL DEFAULT false,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS group_roles_group_namex ON group_roles (group_id, name);
+`
+
+const groupRoleAssignmentsDDL = `
+CREATE TABLE IF NOT EXISTS group_role_assignments (
+	assignment_id VARCHAR(36) PRIMARY KEY,
+	group_id      VARCHAR(36) NOT NULL REFERENCES groups ON DELETE CASCADE,
+	user_id       VARCHAR(36) NOT NULL REFERENCES users ON DELETE CASCADE,
+	role_id       VARCHAR(36) NOT NULL REFERENCES group_roles ON DELETE CASCADE,
+	created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS group_role_assignments_group_userx ON group_role_assignments (group_id, user_id);
+`
+
+// GroupRole is a custom, per-group permission set, replacing the fixed
+// ParticipantRole* constants for groups that define their own roles.
+type GroupRole struct {
+	RoleID    string
+	GroupID   string
+	Name      string
+	IsAdmin   bool
+	IsMod     bool
+	CanPost   bool
+	CanInvite bool
+	CreatedAt time.Time
+}
+
+var groupRoleColumns = []string{"role_id", "group_id", "name", "is_admin", "is_mod", "can_post", "can_invite", "created_at"}
+
+func (r *GroupRole) values() []interface{} {
+	return []interface{}{r.RoleID, r.GroupID, r.Name, r.IsAdmin, r.IsMod, r.CanPost, r.CanInvite, r.CreatedAt}
+}
+
+func groupRoleFromRows(row durable.Row) (*GroupRole, error) {
+	var r GroupRole
+	err := row.Scan(&r.RoleID, &r.GroupID, &r.Name, &r.IsAdmin, &r.IsMod, &r.CanPost, &r.CanInvite, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &r, err
+}
+
+// CreateGroupRole defines a new named role for the group, with its own
+// admin/mod/post/invite permissions. Only the group's owner may define
+// roles.
+func (group *Group) CreateGroupRole(mctx *Context, user *User, name string, isAdmin, isMod, canPost, canInvite bool) (*GroupRole, error) {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return nil, session.ForbiddenError(ctx)
+	}
+	role := &GroupRole{
+		RoleID:    uuid.Must(uuid.NewV4()).String(),
+		GroupID:   group.GroupID,
+		Name:      name,
+		IsAdmin:   isAdmin,
+		IsMod:     isMod,
+		CanPost:   canPost,
+		CanInvite: canInvite,
+		CreatedAt: time.Now(),
+	}
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		columns, params := durable.PrepareColumnsWithValues(groupRoleColumns)
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO group_roles(%s) VALUES (%s)", columns, params), role.values()...)
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return role, nil
+}
+
+// UpdateGroupRole edits an existing role's permissions. Only the
+// group's owner may edit roles.
+func (group *Group) UpdateGroupRole(mctx *Context, user *User, roleID, name string, isAdmin, isMod, canPost, canInvite bool) (*GroupRole, error) {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return nil, session.ForbiddenError(ctx)
+	}
+	role := &GroupRole{
+		RoleID:    roleID,
+		GroupID:   group.GroupID,
+		Name:      name,
+		IsAdmin:   isAdmin,
+		IsMod:     isMod,
+		CanPost:   canPost,
+		CanInvite: canInvite,
+	}
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE group_roles SET name=$1, is_admin=$2, is_mod=$3, can_post=$4, can_invite=$5 WHERE role_id=$6 AND group_id=$7",
+			role.Name, role.IsAdmin, role.IsMod, role.CanPost, role.CanInvite, role.RoleID, group.GroupID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return session.NotFoundError(ctx)
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(session.Error); ok {
+			return nil, err
+		}
+		return nil, session.TransactionError(ctx, err)
+	}
+	return role, nil
+}
+
+// DeleteGroupRole removes a custom role. Existing assignments to it are
+// removed along with it via the foreign key's ON DELETE CASCADE. Only
+// the group's owner may delete roles.
+func (group *Group) DeleteGroupRole(mctx *Context, user *User, roleID string) error {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return session.ForbiddenError(ctx)
+	}
+	err := mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM group_roles WHERE role_id=$1 AND group_id=$2", roleID, group.GroupID)
+		return err
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func findGroupRole(ctx context.Context, tx *sql.Tx, roleID string) (*GroupRole, error) {
+	query := fmt.Sprintf("SELECT %s FROM group_roles WHERE role_id=$1", strings.Join(groupRoleColumns, ","))
+	row := tx.QueryRowContext(ctx, query, roleID)
+	return groupRoleFromRows(row)
+}
+
+// AssignGroupRole grants a participant a custom role, replacing any
+// role they were previously assigned in this group. The participant's
+// legacy Role string is kept in sync so code that only understands the
+// built-in ParticipantRole* constants still sees a sensible value. Only
+// the group's owner may assign roles.
+func (group *Group) AssignGroupRole(mctx *Context, user *User, userID, roleID string) error {
+	ctx := mctx.context
+	if user.UserID != group.UserID {
+		return session.ForbiddenError(ctx)
+	}
+	return mctx.database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		role, err := findGroupRole(ctx, tx, roleID)
+		if err != nil {
+			return err
+		} else if role == nil || role.GroupID != group.GroupID {
+			return session.NotFoundError(ctx)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO group_role_assignments(assignment_id, group_id, user_id, role_id, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (group_id, user_id) DO UPDATE SET role_id=EXCLUDED.role_id, created_at=EXCLUDED.created_at
+		`, uuid.Must(uuid.NewV4()).String(), group.GroupID, userID, roleID, time.Now())
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, "UPDATE participants SET role=$1 WHERE group_id=$2 AND user_id=$3", role.Name, group.GroupID, userID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return session.NotFoundError(ctx)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"satellity/internal/durable"
+	"satellity/internal/notifier"
+	"time"
+)
+
+// defaultNotifier is the transport CreateGroupInvitation delivers through
+// once the invitation row is committed. It defaults to a no-op so the
+// package is usable without configuring a real transport; call
+// SetNotifier during application startup to wire SMTP/webhook/in-app.
+var defaultNotifier notifier.Notifier = notifier.NoOp{}
+
+// SetNotifier configures the transport used to deliver group invitations.
+func SetNotifier(n notifier.Notifier) {
+	defaultNotifier = n
+}
+
+const (
+	// maxInvitationSendAttempts bounds the background retry worker so a
+	// permanently failing address doesn't retry forever.
+	maxInvitationSendAttempts = 8
+	// invitationRetryBaseDelay is the base of the exponential backoff
+	// applied between delivery attempts: baseDelay * 2^attempts.
+	invitationRetryBaseDelay = 30 * time.Second
+)
+
+// deliverInvitation sends the invitation through defaultNotifier and
+// records the outcome on the invitation row, so a transient failure is
+// visible and retryable rather than silently dropped.
+func deliverInvitation(ctx context.Context, db *durable.Database, invitation *GroupInvitation, groupName string) error {
+	n := defaultNotifier
+	if smtpNotifier, ok := n.(notifier.SMTPNotifier); ok {
+		var settings *GroupSettings
+		err := db.RunInTransaction(ctx, func(tx *sql.Tx) error {
+			var err error
+			settings, err = findGroupSettings(ctx, tx, invitation.GroupID)
+			return err
+		})
+		if err == nil {
+			n = smtpNotifier.WithGroupOverride(settings.SMTPHost, settings.SMTPPort, settings.SMTPUsername, settings.SMTPPassword, settings.SMTPFrom)
+		}
+	}
+	sendErr := n.Send(ctx, notifier.Notification{
+		InvitationID: invitation.InvitationID,
+		GroupID:      invitation.GroupID,
+		GroupName:    groupName,
+		Email:        invitation.Email,
+		Code:         invitation.Code,
+	})
+	txErr := db.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+		if sendErr != nil {
+			_, err := tx.ExecContext(ctx,
+				"UPDATE group_invitations SET sent_error=$1, send_attempts=send_attempts+1, last_attempt_at=$2 WHERE invitation_id=$3",
+				sendErr.Error(), now, invitation.InvitationID)
+			return err
+		}
+		_, err := tx.ExecContext(ctx,
+			"UPDATE group_invitations SET sent_at=$1, sent_error='', send_attempts=send_attempts+1, last_attempt_at=$1 WHERE invitation_id=$2",
+			now, invitation.InvitationID)
+		return err
+	})
+	if txErr != nil {
+		return txErr
+	}
+	return sendErr
+}
+
+// nextRetryDue reports whether an unsent invitation's exponential
+// backoff window has elapsed, given its last attempt (or creation time,
+// if it has never been attempted).
+func nextRetryDue(invitation *GroupInvitation) bool {
+	last := invitation.LastAttemptAt
+	if last.IsZero() {
+		last = invitation.CreatedAt
+	}
+	backoff := invitationRetryBaseDelay << uint(invitation.SendAttempts)
+	return time.Now().After(last.Add(backoff))
+}
+
+func findUnsentInvitations(ctx context.Context, tx *sql.Tx, olderThan time.Duration) ([]*GroupInvitation, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT invitation_id, group_id, email, actor_uri, code, sent_at, sent_error, send_attempts, last_attempt_at, created_at FROM group_invitations WHERE sent_at IS NULL AND send_attempts < $1 AND created_at < $2",
+		maxInvitationSendAttempts, time.Now().Add(-olderThan))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*GroupInvitation
+	for rows.Next() {
+		invitation, err := groupInvitationFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// RunInvitationDeliveryWorker periodically scans for invitations that
+// haven't been sent yet and retries delivery with exponential backoff,
+// so a transient SMTP or webhook failure doesn't silently drop the
+// invite. It runs until ctx is cancelled.
+func RunInvitationDeliveryWorker(ctx context.Context, db *durable.Database, scanInterval, minAge time.Duration) {
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			retryUnsentInvitations(ctx, db, minAge)
+		}
+	}
+}
+
+func retryUnsentInvitations(ctx context.Context, db *durable.Database, minAge time.Duration) {
+	var invitations []*GroupInvitation
+	err := db.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		invitations, err = findUnsentInvitations(ctx, tx, minAge)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	for _, invitation := range invitations {
+		if !nextRetryDue(invitation) {
+			continue
+		}
+		var groupName string
+		err := db.RunInTransaction(ctx, func(tx *sql.Tx) error {
+			group, err := findGroup(ctx, tx, invitation.GroupID)
+			if err != nil || group == nil {
+				return err
+			}
+			groupName = group.Name
+			return nil
+		})
+		if err != nil {
+			continue
+		}
+		deliverInvitation(ctx, db, invitation, groupName)
+	}
+}
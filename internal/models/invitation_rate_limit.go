@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"satellity/internal/session"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const invitationRateLimitsDDL = `
+CREATE TABLE IF NOT EXISTS invitation_rate_limits (
+	rate_limit_id VARCHAR(36) PRIMARY KEY,
+	rate_key      VARCHAR(256) NOT NULL,
+	created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitation_rate_limits_keyx ON invitation_rate_limits (rate_key, created_at);
+`
+
+const invitationAttemptsDDL = `
+CREATE TABLE IF NOT EXISTS invitation_attempts (
+	attempt_id    VARCHAR(36) PRIMARY KEY,
+	invitation_id VARCHAR(36) NOT NULL REFERENCES group_invitations ON DELETE CASCADE,
+	ip            VARCHAR(64) NOT NULL,
+	created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitation_attempts_invitationx ON invitation_attempts (invitation_id, created_at);
+`
+
+const (
+	// IssuanceRateLimit is how many invitations a single (user, group) or
+	// (email, group) pair may trigger within IssuanceRateWindow.
+	IssuanceRateLimit  = 5
+	IssuanceRateWindow = time.Hour
+
+	// MaxInvitationCodeAttempts is how many wrong codes an invitation
+	// tolerates within InvitationAttemptWindow before it is invalidated
+	// and must be re-issued.
+	MaxInvitationCodeAttempts = 5
+	InvitationAttemptWindow   = 15 * time.Minute
+)
+
+// checkAndRecordRateLimit counts rows for key created within window and
+// errors once limit is reached, otherwise records this occurrence.
+func checkAndRecordRateLimit(ctx context.Context, tx *sql.Tx, key string, limit int, window time.Duration) error {
+	var count int64
+	err := tx.QueryRowContext(ctx, "SELECT count(*) FROM invitation_rate_limits WHERE rate_key=$1 AND created_at > $2", key, time.Now().Add(-window)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= int64(limit) {
+		return session.TooManyGroupInvitationsError(ctx)
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO invitation_rate_limits(rate_limit_id, rate_key, created_at) VALUES ($1, $2, $3)",
+		uuid.Must(uuid.NewV4()).String(), key, time.Now())
+	return err
+}
+
+// invitationLockedOut reports whether failures (the count returned by
+// recordInvitationFailure) has crossed MaxInvitationCodeAttempts and the
+// invitation should be invalidated rather than accept further guesses.
+func invitationLockedOut(failures int64) bool {
+	return failures >= MaxInvitationCodeAttempts
+}
+
+// recordInvitationFailure logs a failed redemption attempt against an
+// invitation and returns how many failures it has accrued within
+// InvitationAttemptWindow, including this one.
+func recordInvitationFailure(ctx context.Context, tx *sql.Tx, invitationID, ip string) (int64, error) {
+	_, err := tx.ExecContext(ctx, "INSERT INTO invitation_attempts(attempt_id, invitation_id, ip, created_at) VALUES ($1, $2, $3, $4)",
+		uuid.Must(uuid.NewV4()).String(), invitationID, ip, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM invitation_attempts WHERE invitation_id=$1 AND created_at > $2", invitationID, time.Now().Add(-InvitationAttemptWindow)).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,20 @@
+package models
+
+import "testing"
+
+func TestInvitationLockedOut(t *testing.T) {
+	cases := []struct {
+		failures int64
+		locked   bool
+	}{
+		{0, false},
+		{MaxInvitationCodeAttempts - 1, false},
+		{MaxInvitationCodeAttempts, true},
+		{MaxInvitationCodeAttempts + 1, true},
+	}
+	for _, c := range cases {
+		if got := invitationLockedOut(c.failures); got != c.locked {
+			t.Errorf("invitationLockedOut(%d) = %v, want %v", c.failures, got, c.locked)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package notifier
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const notificationsDDL = `
+CREATE TABLE IF NOT EXISTS notifications (
+	notification_id VARCHAR(36) PRIMARY KEY,
+	user_email      VARCHAR(512) NOT NULL,
+	kind            VARCHAR(64) NOT NULL,
+	payload         TEXT NOT NULL,
+	created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+// InAppNotifier records the invitation as a row a user will see the next
+// time they open the app, for installs with no outbound email or
+// webhook configured.
+type InAppNotifier struct {
+	DB *sql.DB
+}
+
+// Send implements Notifier.
+func (in InAppNotifier) Send(ctx context.Context, n Notification) error {
+	_, err := in.DB.ExecContext(ctx,
+		"INSERT INTO notifications(notification_id, user_email, kind, payload, created_at) VALUES ($1, $2, $3, $4, $5)",
+		uuid.Must(uuid.NewV4()).String(), n.Email, "group_invitation", n.Code, time.Now())
+	return err
+}
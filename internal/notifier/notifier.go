@@ -0,0 +1,33 @@
+// Package notifier delivers group invitations through pluggable
+// transports (SMTP, webhook, in-app) so that `CreateGroupInvitation`
+// isn't hardwired to any single channel.
+package notifier
+
+import "context"
+
+// Notification is the payload handed to a Notifier backend to deliver a
+// group invitation.
+type Notification struct {
+	InvitationID string
+	GroupID      string
+	GroupName    string
+	Email        string
+	Code         string
+}
+
+// Notifier delivers a Notification, returning an error if delivery could
+// not be confirmed. Implementations should be safe to retry: the caller
+// may call Send again for the same Notification after a transient error.
+type Notifier interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// NoOp is the zero-value Notifier: it drops every notification. It
+// exists so code that hasn't configured a real transport still compiles
+// and runs, rather than nil-panicking.
+type NoOp struct{}
+
+// Send implements Notifier.
+func (NoOp) Send(ctx context.Context, n Notification) error {
+	return nil
+}
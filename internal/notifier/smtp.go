@@ -0,0 +1,50 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPNotifier delivers invitations as email, optionally authenticating
+// as a group's own address so owners can send invites from their own
+// mailbox rather than the instance-wide sender.
+type SMTPNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Notifier.
+func (s SMTPNotifier) Send(ctx context.Context, n Notification) error {
+	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	email := stripCRLF(n.Email)
+	subject := fmt.Sprintf("You're invited to join %s", stripCRLF(n.GroupName))
+	body := fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\nYour invitation code is %s.\r\n", email, subject, n.Code)
+	return smtp.SendMail(addr, auth, s.From, []string{email}, []byte(body))
+}
+
+// stripCRLF removes embedded carriage returns and newlines so untrusted
+// values (an invitee's email, a group's display name) can't be used to
+// inject extra headers or recipients into the raw message built above.
+func stripCRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.ReplaceAll(s, "\n", "")
+}
+
+// WithGroupOverride returns a copy of s using a group owner's own SMTP
+// credentials in place of the instance default, for the "send from my
+// own address" case.
+func (s SMTPNotifier) WithGroupOverride(host string, port int, username, password, from string) SMTPNotifier {
+	if host == "" {
+		return s
+	}
+	return SMTPNotifier{Host: host, Port: port, Username: username, Password: password, From: from}
+}
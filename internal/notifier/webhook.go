@@ -0,0 +1,43 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// WebhookNotifier POSTs the notification as JSON to a configured URL,
+// for integrations (chat bots, external ticketing) that want to react
+// to an invitation being issued.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Send implements Notifier.
+func (w WebhookNotifier) Send(ctx context.Context, n Notification) error {
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook notifier: %s returned status %d", w.URL, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"satellity/internal/durable"
+	"satellity/internal/models"
+	"satellity/internal/session"
+	"satellity/middleware"
+)
+
+// groupActorDocument is the ActivityPub actor document we serve for our
+// own groups, so remote servers can resolve our public key and inbox
+// URL the same way FetchRemoteActorKey and resolveRemoteInbox resolve
+// theirs.
+type groupActorDocument struct {
+	Context   []string            `json:"@context"`
+	ID        string              `json:"id"`
+	Type      string              `json:"type"`
+	Inbox     string              `json:"inbox"`
+	Outbox    string              `json:"outbox"`
+	Followers string              `json:"followers"`
+	PublicKey groupActorPublicKey `json:"publicKey"`
+}
+
+type groupActorPublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// GroupFederationRouter serves a group's ActivityPub surface: GET
+// "/groups/{id}" returns the actor document, unsigned like any other
+// server's actor endpoint (a remote server needs this to learn our
+// public key before it can even check a signature), and POST
+// "/groups/{id}/inbox" is the signed inbox, verified by HTTPSignature
+// before anything in the request body is trusted. Mount it at
+// "/groups/" in the instance's router, e.g.
+// `mux.Handle("/groups/", views.GroupFederationRouter(db))`.
+func GroupFederationRouter(db *durable.Database) http.Handler {
+	inbox := middleware.HTTPSignature(models.FetchRemoteActorKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupID, ok := parseGroupInboxPath(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		handleGroupInbox(w, r, db, groupID)
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if groupID, ok := parseGroupActorPath(r.URL.Path); ok {
+				handleGroupActorDocument(w, r, db, groupID)
+				return
+			}
+		}
+		inbox.ServeHTTP(w, r)
+	})
+}
+
+func handleGroupActorDocument(w http.ResponseWriter, r *http.Request, db *durable.Database, groupID string) {
+	mctx := models.NewContext(r.Context(), db)
+	actor, err := models.FindGroupActorDocument(mctx, groupID)
+	if err != nil {
+		RenderErrorResponse(w, r, err)
+		return
+	}
+	if actor == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/activity+json")
+	json.NewEncoder(w).Encode(groupActorDocument{
+		Context:   []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+		ID:        actor.ActorURI,
+		Type:      "Group",
+		Inbox:     actor.InboxURI,
+		Outbox:    actor.OutboxURI,
+		Followers: actor.FollowersURI,
+		PublicKey: groupActorPublicKey{
+			ID:           actor.ActorURI + "#main-key",
+			Owner:        actor.ActorURI,
+			PublicKeyPem: actor.PublicKey,
+		},
+	})
+}
+
+func handleGroupInbox(w http.ResponseWriter, r *http.Request, db *durable.Database, groupID string) {
+	mctx := models.NewContext(r.Context(), db)
+	group, err := models.FindGroupForInbox(mctx, groupID)
+	if err != nil {
+		RenderErrorResponse(w, r, err)
+		return
+	}
+	if group == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var activity models.Activity
+	if err := json.NewDecoder(r.Body).Decode(&activity); err != nil {
+		RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+		return
+	}
+	verifiedActor, ok := middleware.VerifiedActor(r)
+	if !ok {
+		RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+		return
+	}
+	if err := dispatchGroupActivity(mctx, group, &activity, verifiedActor); err != nil {
+		RenderErrorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// parseGroupInboxPath extracts the groupID from a "/groups/{id}/inbox"
+// request path.
+func parseGroupInboxPath(path string) (groupID string, ok bool) {
+	const prefix, suffix = "/groups/", "/inbox"
+	if !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) {
+		return "", false
+	}
+	groupID = strings.TrimSuffix(strings.TrimPrefix(path, prefix), suffix)
+	if groupID == "" {
+		return "", false
+	}
+	return groupID, true
+}
+
+// parseGroupActorPath extracts the groupID from a bare "/groups/{id}"
+// request path (no further path segments).
+func parseGroupActorPath(path string) (groupID string, ok bool) {
+	const prefix = "/groups/"
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+	rest := strings.TrimPrefix(path, prefix)
+	if rest == "" || strings.Contains(rest, "/") {
+		return "", false
+	}
+	return rest, true
+}
+
+// dispatchGroupActivity routes a verified inbound activity to the
+// matching handler. verifiedActor is the cryptographically verified
+// sender, and every handler below checks it against whatever the
+// activity body claims before acting on it.
+func dispatchGroupActivity(mctx *models.Context, group *models.Group, activity *models.Activity, verifiedActor string) error {
+	switch activity.Type {
+	case "Follow":
+		return group.HandleGroupFollow(mctx, activity, verifiedActor)
+	case "Undo":
+		return group.HandleGroupUndoFollow(mctx, activity, verifiedActor)
+	case "Accept":
+		_, err := models.JoinGroupByFederatedInvitation(mctx, group.GroupID, verifiedActor, activity)
+		return err
+	default:
+		return nil
+	}
+}
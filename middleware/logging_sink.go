@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Sink is where structured request log records are shipped. Implementing
+// this lets records go to stdout, a file, or an external aggregator
+// without changing the logging middleware itself.
+type Sink interface {
+	Write(record LogRecord)
+}
+
+// StdoutSink writes each record as a single line of JSON to stdout.
+type StdoutSink struct{}
+
+// Write implements Sink.
+func (StdoutSink) Write(record LogRecord) {
+	writeJSONLine(os.Stdout, record)
+}
+
+// WriterSink writes each record as a single line of JSON to an arbitrary
+// io.Writer, such as an open log file.
+type WriterSink struct {
+	Writer io.Writer
+}
+
+// Write implements Sink.
+func (s WriterSink) Write(record LogRecord) {
+	writeJSONLine(s.Writer, record)
+}
+
+func writeJSONLine(w io.Writer, record LogRecord) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	w.Write(append(encoded, '\n'))
+}